@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package vsphere
+
+// Reference identifies an NSX-T object created on behalf of a shoot: its
+// Advanced-API id and, for Policy-API objects, its hierarchical path.
+type Reference struct {
+	ID   string
+	Path string
+}
+
+// NSXTInfraState persists the NSX-T object references the ensurer has
+// created (or recovered) while reconciling a shoot's infrastructure, so a
+// later reconcile finds them again instead of creating them a second time.
+type NSXTInfraState struct {
+	// References holds the reference produced by each task, keyed by the
+	// task's Label().
+	References map[string]*Reference
+
+	// PrincipalIdentityName is the NSX-T Principal Identity created to
+	// authenticate as this shoot, if any.
+	PrincipalIdentityName string
+
+	// VPC holds the references to the NSX-T Project/VPC this shoot was
+	// provisioned under, when using the VPC infrastructure mode. It is nil
+	// for the default policy-tier1 mode.
+	VPC *VPCState
+}
+
+// VPCState holds the NSX-T Project/VPC references used by the VPC
+// infrastructure mode to scope tag-based lookup and orphan sweeps to the
+// shoot's own project, rather than all of /infra.
+type VPCState struct {
+	ProjectID string
+	VPCPath   string
+}
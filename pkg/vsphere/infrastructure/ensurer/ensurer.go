@@ -18,150 +18,67 @@
 package ensurer
 
 import (
-	"fmt"
-
 	"github.com/go-logr/logr"
-	"github.com/pkg/errors"
-	"github.com/vmware/go-vmware-nsxt"
-	"github.com/vmware/vsphere-automation-sdk-go/runtime/log"
-	vapiclient "github.com/vmware/vsphere-automation-sdk-go/runtime/protocol/client"
 
 	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
 	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
 	"github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
 )
 
+// ensurer drives the default policy-tier1 NSX-T infrastructure pipeline:
+// a Tier-1 gateway and Segment under /infra. It only adds the policy-tier1
+// task list and tag scope on top of ensurerCore, which does the actual
+// scheduling - see schedule.go.
 type ensurer struct {
-	logger logr.Logger
-	// connector for simplified API (NSXT policy)
-	connector vapiclient.Connector
-	// nsxtClient is the NSX Manager client - based on go-vmware-nsxt SDK (Advanced API)
-	nsxtClient *nsxt.APIClient
-	tasks      []task.Task
+	*ensurerCore
 }
 
 var _ task.EnsurerContext = &ensurer{}
-
-func (e *ensurer) Logger() logr.Logger {
-	return e.logger
-}
-
-func (e *ensurer) Connector() vapiclient.Connector {
-	return e.connector
+var _ vinfra.NSXTInfrastructureEnsurer = &ensurer{}
+
+// defaultTaskNames lists the tasks registered in task.Registry that make up
+// the policy-tier1 pipeline, in their default execution order. Operators can
+// override this list (e.g. to drop the Advanced-API DHCP tasks on NSX-T 4.x,
+// where the Advanced API has been retired) via WithEnabledTasks.
+var defaultTaskNames = []string{
+	"lookup-tier0-gateway",
+	"lookup-transport-zone",
+	"lookup-edge-cluster",
+	"lookup-snat-ip-pool",
+	"tier1-gateway",
+	"tier1-gateway-locale-service",
+	"segment",
+	"snat-ip-address-allocation",
+	"snat-ip-address-realization",
+	"snat-rule",
+	"advanced-lookup-logical-switch",
+	"advanced-dhcp-profile",
+	"advanced-dhcp-server",
+	"advanced-dhcp-port",
+	"advanced-dhcp-ip-pool",
 }
 
-func (e *ensurer) NSXTClient() *nsxt.APIClient {
-	return e.nsxtClient
+// policyRecoverTags scopes tag-based lookup (recovering a lost reference,
+// sweeping orphans) to the shoot's cluster tag - the policy-tier1 pipeline
+// has no project to further scope it to.
+func policyRecoverTags(spec vinfra.NSXTInfraSpec, _ *api.NSXTInfraState) []vinfra.Tag {
+	return spec.CreateTags()
 }
 
-func (e *ensurer) IsTryRecoverEnabled() bool {
-	return true
-}
-
-func NewNSXTInfrastructureEnsurer(logger logr.Logger, nsxtConfig *vinfra.NSXTConfig) (vinfra.NSXTInfrastructureEnsurer, error) {
-	log.SetLogger(NewLogrBridge(logger))
-	connector, err := createConnector(nsxtConfig)
-	if err != nil {
-		return nil, errors.Wrapf(err, "creating NSX-T connector failed")
+// NewNSXTInfrastructureEnsurer creates the ensurer driving the shoot's
+// NSX-T infrastructure pipeline. By default this is the policy-tier1
+// pipeline (defaultTaskNames); set nsxtConfig.Mode to vinfra.NSXTModeVPC to
+// get the NSX-T Projects/VPC pipeline instead. WithEnabledTasks and
+// WithExtraTasks customize which tasks run without having to touch every
+// existing call site - see Option.
+func NewNSXTInfrastructureEnsurer(logger logr.Logger, nsxtConfig *vinfra.NSXTConfig, opts ...Option) (vinfra.NSXTInfrastructureEnsurer, error) {
+	if nsxtConfig.Mode == vinfra.NSXTModeVPC {
+		return NewNSXTVPCInfrastructureEnsurer(logger, nsxtConfig, opts...)
 	}
-	nsxClient, err := createNSXClient(nsxtConfig)
-	if err != nil {
-		return nil, errors.Wrapf(err, "creating NSX-T client failed")
-	}
-
-	tasks := []task.Task{
-		task.NewLookupTier0GatewayTask(),
-		task.NewLookupTransportZoneTask(),
-		task.NewLookupEdgeClusterTask(),
-		task.NewLookupSNATIPPoolTask(),
-		task.NewTier1GatewayTask(),
-		task.NewTier1GatewayLocaleServiceTask(),
-		task.NewSegmentTask(),
-		task.NewSNATIPAddressAllocationTask(),
-		task.NewSNATIPAddressRealizationTask(),
-		task.NewSNATRuleTask(),
-		task.NewAdvancedLookupLogicalSwitchTask(),
-		task.NewAdvancedDHCPProfileTask(),
-		task.NewAdvancedDHCPServerTask(),
-		task.NewAdvancedDHCPPortTask(),
-		task.NewAdvancedDHCPIPPoolTask(),
-	}
-
-	return &ensurer{
-		logger:     logger,
-		connector:  connector,
-		nsxtClient: nsxClient,
-		tasks:      tasks,
-	}, nil
-}
 
-func (e *ensurer) EnsureInfrastructure(spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) error {
-	for _, tsk := range e.tasks {
-		_ = e.tryRecover(spec, state, tsk, false)
-
-		action, err := tsk.Ensure(e, spec, state)
-		if err != nil {
-			return errors.Wrapf(err, tsk.Label()+" failed")
-		}
-		keysAndVals := []interface{}{}
-		name := tsk.NameToLog(spec)
-		if name != nil {
-			keysAndVals = append(keysAndVals, "name", *name)
-		}
-		ref := tsk.Reference(state)
-		if ref != nil {
-			keysAndVals = append(keysAndVals, "id", ref.ID)
-		}
-		e.logger.Info(fmt.Sprintf("%s %s", tsk.Label(), action), keysAndVals...)
-	}
-
-	return nil
-}
-
-// tryRecover tries if the NSX-T reference has for some reason been lost and not be stored in the state.
-// It then tries to find the object by the garden and shoot tag to restore the reference.
-func (e *ensurer) tryRecover(spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState, tsk task.Task, lookup bool) error {
-	if e.IsTryRecoverEnabled() && tsk.Reference(state) == nil {
-		if rt, ok := tsk.(task.RecoverableTask); ok {
-			task.TryRecover(e, state, rt, spec.CreateTags())
-		} else if rt, ok := tsk.(task.RecoverableAdvancedTask); ok {
-			rt.TryRecover(e, state, spec.CreateCommonTags())
-		} else if lookup {
-			// not recoverable tasks are lookup tasks which may be needed for recover
-			var err error
-			_, err = tsk.Ensure(e, spec, state)
-			return err
-		}
-	}
-	return nil
-}
-
-func (e *ensurer) EnsureInfrastructureDeleted(spec *vinfra.NSXTInfraSpec, state *api.NSXTInfraState) error {
-	if spec != nil {
-		// tryRecover needs the order of creation
-		for _, tsk := range e.tasks {
-			err := e.tryRecover(*spec, state, tsk, true)
-			if err != nil {
-				keysAndVals := []interface{}{}
-				name := tsk.NameToLog(*spec)
-				if name != nil {
-					keysAndVals = append(keysAndVals, "name", *name)
-				}
-				e.logger.Info("try recover failed", keysAndVals...)
-			}
-		}
-	}
-
-	for i := len(e.tasks) - 1; i >= 0; i-- {
-		tsk := e.tasks[i]
-
-		deleted, err := tsk.EnsureDeleted(e, state)
-		if err != nil {
-			return errors.Wrapf(err, "deleting "+tsk.Label()+" failed")
-		}
-		if deleted {
-			e.logger.Info(tsk.Label() + " deleted")
-		}
+	core, err := newEnsurerCore(logger, nsxtConfig, defaultTaskNames, policyRecoverTags, opts)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return &ensurer{ensurerCore: core}, nil
 }
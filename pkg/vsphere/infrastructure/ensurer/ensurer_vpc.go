@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"github.com/go-logr/logr"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+	"github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
+)
+
+// defaultVPCTaskNames lists the tasks registered in task.Registry that
+// provision a shoot as a VPC under an NSX-T Project - the multi-tenant
+// counterpart to defaultTaskNames's Tier-1-under-/infra pipeline.
+var defaultVPCTaskNames = []string{
+	"lookup-project",
+	"vpc",
+	"vpc-subnet",
+	"vpc-snat",
+}
+
+// vpcEnsurer drives the NSX-T Projects/VPC infrastructure pipeline, used
+// when NSXTConfig.Mode is vinfra.NSXTModeVPC instead of the default
+// vinfra.NSXTModePolicyTier1. It only adds the VPC task list and
+// project-scoped tag recovery on top of ensurerCore, which both ensurer and
+// vpcEnsurer schedule tasks through - see schedule.go.
+type vpcEnsurer struct {
+	*ensurerCore
+}
+
+var _ task.EnsurerContext = &vpcEnsurer{}
+var _ vinfra.NSXTInfrastructureEnsurer = &vpcEnsurer{}
+
+// vpcRecoverTags scopes tag-based lookup (recovering a lost reference,
+// sweeping orphans) to the shoot's project, since VPC objects live under a
+// project rather than directly under /infra.
+func vpcRecoverTags(spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) []vinfra.Tag {
+	return spec.CreateProjectScopedTags(state.VPC)
+}
+
+// NewNSXTVPCInfrastructureEnsurer creates the ensurer driving the NSX-T
+// Projects/VPC pipeline (defaultVPCTaskNames), provisioning the shoot as a
+// VPC under an org/project instead of a Tier-1 gateway and Segment under
+// /infra. WithEnabledTasks and WithExtraTasks customize which tasks run,
+// the same as for NewNSXTInfrastructureEnsurer.
+func NewNSXTVPCInfrastructureEnsurer(logger logr.Logger, nsxtConfig *vinfra.NSXTConfig, opts ...Option) (vinfra.NSXTInfrastructureEnsurer, error) {
+	core, err := newEnsurerCore(logger, nsxtConfig, defaultVPCTaskNames, vpcRecoverTags, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &vpcEnsurer{ensurerCore: core}, nil
+}
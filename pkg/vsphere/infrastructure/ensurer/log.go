@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+	"github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
+)
+
+// taskLogger wraps logr.Logger to keep the set of structured fields emitted
+// for a task consistent across the ensurer: task, action, nsxt_id,
+// nsxt_path, shoot, duration_ms and attempt. It is intentionally thin - the
+// actual JSON encoding is left to the logr sink configured by the caller
+// (e.g. zapr), this type only normalizes the field names and values.
+type taskLogger struct {
+	delegate logr.Logger
+	shoot    string
+}
+
+// newTaskLogger wraps delegate for use by the ensurer.
+func newTaskLogger(delegate logr.Logger) *taskLogger {
+	return &taskLogger{delegate: delegate}
+}
+
+// withShoot returns a copy of l that tags every entry with the given
+// shoot's cluster name.
+func (l *taskLogger) withShoot(shoot string) *taskLogger {
+	return &taskLogger{delegate: l.delegate, shoot: shoot}
+}
+
+// forTask returns a child logr.Logger scoped to the given task, so log
+// lines produced while a task is running carry task=<Label> without every
+// call site having to add it explicitly.
+func (l *taskLogger) forTask(label string) logr.Logger {
+	return l.delegate.WithValues("task", label, "shoot", l.shoot)
+}
+
+// logResult logs the outcome of a task.Ensure call with the reference it
+// produced (if any) and how long the call took. ref.Path is only set for
+// Policy-API tasks (e.g. Tier1GatewayTask, SegmentTask); Advanced-API tasks
+// only populate ID, so nsxt_path is omitted for them.
+func (l *taskLogger) logResult(tsk task.Task, action string, spec vinfra.NSXTInfraSpec, ref *api.Reference, start time.Time, attempt int) {
+	keysAndVals := []interface{}{"action", action, "duration_ms", time.Since(start).Milliseconds()}
+	if attempt > 0 {
+		keysAndVals = append(keysAndVals, "attempt", attempt)
+	}
+	if name := tsk.NameToLog(spec); name != nil {
+		keysAndVals = append(keysAndVals, "name", *name)
+	}
+	if ref != nil {
+		keysAndVals = append(keysAndVals, "nsxt_id", ref.ID)
+		if ref.Path != "" {
+			keysAndVals = append(keysAndVals, "nsxt_path", ref.Path)
+		}
+	}
+	l.forTask(tsk.Label()).Info(action, keysAndVals...)
+}
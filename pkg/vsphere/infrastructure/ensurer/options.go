@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
+
+// options collects the optional settings NewNSXTInfrastructureEnsurer and
+// NewNSXTVPCInfrastructureEnsurer accept, via Option.
+type options struct {
+	enabledTasks []string
+	extraTasks   []task.Task
+}
+
+// Option customizes the tasks a NewNSXTInfrastructureEnsurer or
+// NewNSXTVPCInfrastructureEnsurer ensurer runs. It's variadic rather than a
+// required positional argument so adding a new option never breaks an
+// existing call site that only passes a logger and a config.
+type Option func(*options)
+
+// WithEnabledTasks overrides the default task list (defaultTaskNames or
+// defaultVPCTaskNames) with names, resolved against task.Registry. Use it
+// to drop tasks an environment doesn't need, e.g. the Advanced-API DHCP
+// tasks on an NSX-T version where the Advanced API has been retired.
+func WithEnabledTasks(names []string) Option {
+	return func(o *options) { o.enabledTasks = names }
+}
+
+// WithExtraTasks appends tasks after the resolved enabledTasks, so
+// out-of-tree tasks (custom tags, a per-shoot DFW section, ...) can be
+// injected without modifying this package.
+func WithExtraTasks(tasks ...task.Task) Option {
+	return func(o *options) { o.extraTasks = append(o.extraTasks, tasks...) }
+}
+
+func resolveOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"time"
+
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+// defaultRateLimitQPS and defaultRateLimitBurst are used when NSXTConfig
+// doesn't set RateLimitQPS/RateLimitBurst. 20 requests/s with a burst of 20
+// mirrors the default rate NSX-T Manager itself enforces per client.
+const (
+	defaultRateLimitQPS   = 20
+	defaultRateLimitBurst = 20
+)
+
+// tokenBucket is a minimal token-bucket rate limiter: it starts with burst
+// tokens and refills one token every interval, blocking Wait callers until a
+// token is available or their context is done.
+type tokenBucket struct {
+	tokens chan struct{}
+	done   chan struct{}
+}
+
+// newTokenBucket creates a tokenBucket that allows burst calls immediately
+// and thereafter refills at one token per interval, until Close is called.
+func newTokenBucket(interval time.Duration, burst int) *tokenBucket {
+	b := &tokenBucket{
+		tokens: make(chan struct{}, burst),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < burst; i++ {
+		b.tokens <- struct{}{}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case b.tokens <- struct{}{}:
+				default:
+				}
+			case <-b.done:
+				return
+			}
+		}
+	}()
+
+	return b
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	select {
+	case <-b.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the refill goroutine. A bucket whose owner never calls this
+// (e.g. one created per ensurer, where the ensurer is created per reconcile)
+// leaks both the goroutine and its ticker for as long as the process runs.
+// After Close, Wait only hands out tokens still left in the bucket and
+// otherwise blocks until its context is done, since nothing refills it.
+func (b *tokenBucket) Close() {
+	close(b.done)
+}
+
+// rateLimiterFromConfig builds the per-connector rate limiter for an
+// ensurer, falling back to defaultRateLimitQPS/defaultRateLimitBurst when
+// nsxtConfig leaves RateLimitQPS/RateLimitBurst at their zero value. Each
+// ensurer gets its own limiter (rather than one shared across the process)
+// since it already owns a single NSX-T connector to bound calls on.
+func rateLimiterFromConfig(nsxtConfig *vinfra.NSXTConfig) *tokenBucket {
+	qps := nsxtConfig.RateLimitQPS
+	if qps <= 0 {
+		qps = defaultRateLimitQPS
+	}
+	burst := nsxtConfig.RateLimitBurst
+	if burst <= 0 {
+		burst = defaultRateLimitBurst
+	}
+	return newTokenBucket(time.Duration(float64(time.Second)/qps), burst)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+func TestTokenBucketAllowsBurstImmediately(t *testing.T) {
+	b := newTokenBucket(time.Hour, 3)
+	t.Cleanup(b.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(ctx); err != nil {
+			t.Fatalf("Wait() call %d within the burst failed: %v", i+1, err)
+		}
+	}
+}
+
+func TestTokenBucketBlocksOnceBurstIsSpent(t *testing.T) {
+	b := newTokenBucket(time.Hour, 1)
+	t.Cleanup(b.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("first Wait() failed: %v", err)
+	}
+	if err := b.Wait(ctx); err == nil {
+		t.Fatalf("second Wait() should have blocked until ctx was done, but succeeded")
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(10*time.Millisecond, 1)
+	t.Cleanup(b.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("first Wait() failed: %v", err)
+	}
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Wait() after the refill interval failed: %v", err)
+	}
+}
+
+func TestTokenBucketCloseStopsRefilling(t *testing.T) {
+	b := newTokenBucket(10*time.Millisecond, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("first Wait() failed: %v", err)
+	}
+
+	b.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err == nil {
+		t.Fatalf("Wait() after Close() should have blocked (no more refills), but succeeded")
+	}
+}
+
+func TestRateLimiterFromConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		nsxtConfig *vinfra.NSXTConfig
+		wantBurst  int
+	}{
+		{name: "zero-value config falls back to defaults", nsxtConfig: &vinfra.NSXTConfig{}, wantBurst: defaultRateLimitBurst},
+		{name: "configured QPS/burst override the defaults", nsxtConfig: &vinfra.NSXTConfig{RateLimitQPS: 100, RateLimitBurst: 5}, wantBurst: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := rateLimiterFromConfig(tt.nsxtConfig)
+			if limiter == nil {
+				t.Fatalf("rateLimiterFromConfig() returned nil")
+			}
+			t.Cleanup(limiter.Close)
+			if got := cap(limiter.tokens); got != tt.wantBurst {
+				t.Fatalf("limiter burst = %d, want %d", got, tt.wantBurst)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if err := limiter.Wait(ctx); err != nil {
+				t.Fatalf("Wait() on a fresh limiter should not block: %v", err)
+			}
+		})
+	}
+}
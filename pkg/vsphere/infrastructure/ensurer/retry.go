@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+// RetryPolicy configures the exponential backoff used to retry a task's
+// Ensure/EnsureDeleted call when NSX-T reports a transient error.
+type RetryPolicy struct {
+	// InitialInterval bounds the delay before the first retry: withRetry
+	// waits a random duration between half of it and all of it. The bound
+	// doubles after every subsequent retry.
+	InitialInterval time.Duration
+	// MaxElapsedTime bounds the total time spent retrying a single task
+	// invocation. Once it would be exceeded, the last error is returned
+	// instead of retrying again.
+	MaxElapsedTime time.Duration
+}
+
+// defaultRetryPolicy is used when NSXTConfig doesn't set RetryInitialInterval
+// or RetryMaxElapsed.
+var defaultRetryPolicy = RetryPolicy{
+	InitialInterval: 500 * time.Millisecond,
+	MaxElapsedTime:  2 * time.Minute,
+}
+
+// retryPolicyFromConfig builds the RetryPolicy for an ensurer, falling back
+// to defaultRetryPolicy for any field nsxtConfig leaves at its zero value.
+func retryPolicyFromConfig(nsxtConfig *vinfra.NSXTConfig) RetryPolicy {
+	policy := defaultRetryPolicy
+	if nsxtConfig.RetryInitialInterval > 0 {
+		policy.InitialInterval = nsxtConfig.RetryInitialInterval
+	}
+	if nsxtConfig.RetryMaxElapsed > 0 {
+		policy.MaxElapsedTime = nsxtConfig.RetryMaxElapsed
+	}
+	return policy
+}
+
+// isRetryableNSXTError classifies an NSX-T error as transient - 429 Too Many
+// Requests, 503 Service Unavailable, or the realized-state-still-pending
+// condition the SDK surfaces while an async NSX-T operation settles - as
+// opposed to terminal errors such as a 400. A 404 on delete is treated by
+// the caller as success rather than reaching this classification at all.
+func isRetryableNSXTError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if se, ok := errors.Cause(err).(interface{ StatusCode() int }); ok {
+		switch se.StatusCode() {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		}
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "realiz") && strings.Contains(msg, "pending")
+}
+
+// withRetry invokes fn, retrying with exponential backoff and jitter while
+// fn's error is classified as retryable by isRetryableNSXTError, until
+// policy.MaxElapsedTime is exhausted or ctx is cancelled. It returns the
+// number of attempts made and fn's last error, if any.
+func withRetry(ctx context.Context, policy RetryPolicy, fn func(attempt int) error) (int, error) {
+	start := time.Now()
+	interval := policy.InitialInterval
+	attempt := 0
+	for {
+		attempt++
+		err := fn(attempt)
+		if err == nil {
+			return attempt, nil
+		}
+		if !isRetryableNSXTError(err) {
+			return attempt, err
+		}
+		if time.Since(start)+interval > policy.MaxElapsedTime {
+			return attempt, err
+		}
+
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval)/2+1))
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(wait):
+		}
+		interval *= 2
+	}
+}
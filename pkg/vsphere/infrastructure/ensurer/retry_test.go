@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type statusCodeError struct {
+	code int
+}
+
+func (e *statusCodeError) Error() string   { return "status error" }
+func (e *statusCodeError) StatusCode() int { return e.code }
+
+func TestIsRetryableNSXTError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil error is not retryable", err: nil, want: false},
+		{name: "429 is retryable", err: &statusCodeError{code: http.StatusTooManyRequests}, want: true},
+		{name: "503 is retryable", err: &statusCodeError{code: http.StatusServiceUnavailable}, want: true},
+		{name: "400 is not retryable", err: &statusCodeError{code: http.StatusBadRequest}, want: false},
+		{name: "wrapped status error is still classified", err: errors.Wrap(&statusCodeError{code: http.StatusTooManyRequests}, "calling NSX-T"), want: true},
+		{name: "realized-state-pending message is retryable", err: errors.New("realization of object still pending"), want: true},
+		{name: "unrelated message is not retryable", err: errors.New("invalid tag"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableNSXTError(tt.err); got != tt.want {
+				t.Fatalf("isRetryableNSXTError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Run("succeeds on first attempt", func(t *testing.T) {
+		attempts, err := withRetry(context.Background(), RetryPolicy{InitialInterval: time.Millisecond, MaxElapsedTime: time.Second}, func(int) error {
+			return nil
+		})
+		if err != nil || attempts != 1 {
+			t.Fatalf("got attempts=%d, err=%v, want attempts=1, err=nil", attempts, err)
+		}
+	})
+
+	t.Run("retries a retryable error until it succeeds", func(t *testing.T) {
+		calls := 0
+		attempts, err := withRetry(context.Background(), RetryPolicy{InitialInterval: time.Millisecond, MaxElapsedTime: time.Second}, func(int) error {
+			calls++
+			if calls < 3 {
+				return &statusCodeError{code: http.StatusTooManyRequests}
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Fatalf("got attempts=%d, err=%v, want attempts=3, err=nil", attempts, err)
+		}
+	})
+
+	t.Run("returns immediately on a non-retryable error", func(t *testing.T) {
+		wantErr := &statusCodeError{code: http.StatusBadRequest}
+		attempts, err := withRetry(context.Background(), RetryPolicy{InitialInterval: time.Millisecond, MaxElapsedTime: time.Second}, func(int) error {
+			return wantErr
+		})
+		if attempts != 1 || err != error(wantErr) {
+			t.Fatalf("got attempts=%d, err=%v, want attempts=1, err=%v", attempts, err, wantErr)
+		}
+	})
+
+	t.Run("gives up once MaxElapsedTime is exhausted", func(t *testing.T) {
+		attempts, err := withRetry(context.Background(), RetryPolicy{InitialInterval: 10 * time.Millisecond, MaxElapsedTime: 5 * time.Millisecond}, func(int) error {
+			return &statusCodeError{code: http.StatusServiceUnavailable}
+		})
+		if err == nil {
+			t.Fatalf("expected an error once MaxElapsedTime is exhausted")
+		}
+		if attempts != 1 {
+			t.Fatalf("got attempts=%d, want 1 (the budget is exhausted before a second attempt)", attempts)
+		}
+	})
+
+	t.Run("stops retrying once ctx is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts, err := withRetry(ctx, RetryPolicy{InitialInterval: 10 * time.Millisecond, MaxElapsedTime: time.Second}, func(int) error {
+			return &statusCodeError{code: http.StatusTooManyRequests}
+		})
+		if err == nil {
+			t.Fatalf("expected an error once ctx is cancelled")
+		}
+		if attempts != 1 {
+			t.Fatalf("got attempts=%d, want 1", attempts)
+		}
+	})
+}
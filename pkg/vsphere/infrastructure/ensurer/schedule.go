@@ -0,0 +1,477 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/go-vmware-nsxt"
+	"github.com/vmware/vsphere-automation-sdk-go/runtime/log"
+	vapiclient "github.com/vmware/vsphere-automation-sdk-go/runtime/protocol/client"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+	"github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
+)
+
+// maxConcurrentTasks bounds how many tasks EnsureInfrastructure runs at the
+// same time. Independent branches of the task graph (e.g. the Advanced-API
+// DHCP subtree and the Policy-API SNAT subtree) execute concurrently once
+// their dependencies are satisfied, but the worker pool keeps the number of
+// parallel NSX-T calls bounded.
+const maxConcurrentTasks = 4
+
+// ensurerCore is the scheduler both ensurer (policy-tier1) and vpcEnsurer
+// (NSX-T Projects/VPC) run their tasks through. The two pipelines only
+// differ in which tasks they run and how they scope the tags used to
+// recover a lost reference and to sweep orphans - everything else
+// (the dependency graph, the worker pool, retry/rate-limit, the delete
+// loop, the orphan sweep and Principal Identity cleanup) was duplicated
+// near-verbatim between the two files before this, which is what
+// recoverTags exists to stop.
+type ensurerCore struct {
+	logger     logr.Logger
+	connector  vapiclient.Connector
+	nsxtClient *nsxt.APIClient
+	tasks      []task.Task
+	// taskLog emits structured, per-task log entries (task, action, nsxt_id,
+	// nsxt_path, shoot, duration_ms, attempt) for EnsureInfrastructure and
+	// EnsureInfrastructureDeleted.
+	taskLog *taskLogger
+	// retryPolicy configures the backoff used to retry a task's Ensure /
+	// EnsureDeleted call when NSX-T reports a transient error.
+	retryPolicy RetryPolicy
+	// limiter bounds the rate of NSX-T API calls issued through connector/
+	// nsxtClient, gated at every attempt (including retries), not just once
+	// per task.
+	limiter *tokenBucket
+	// stateMu guards every read or write of a task's reference in state.
+	// EnsureInfrastructure runs independent branches of the task graph on
+	// separate goroutines, and state is a single object shared by all of
+	// them - without this, concurrent Commit calls (or a Commit racing a
+	// Reference read from tryRecover) are a data race on state.References.
+	stateMu sync.Mutex
+
+	// recoverTags returns the tags used to recover a lost reference (in
+	// tryRecover) and to sweep orphans (in EnsureInfrastructureDeleted):
+	// spec.CreateTags()/CreateCommonTags() for the policy-tier1 pipeline,
+	// spec.CreateProjectScopedTags(state.VPC) for the VPC pipeline.
+	recoverTags func(spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) []vinfra.Tag
+}
+
+func (e *ensurerCore) Logger() logr.Logger {
+	return e.logger
+}
+
+func (e *ensurerCore) Connector() vapiclient.Connector {
+	return e.connector
+}
+
+func (e *ensurerCore) NSXTClient() *nsxt.APIClient {
+	return e.nsxtClient
+}
+
+func (e *ensurerCore) IsTryRecoverEnabled() bool {
+	return true
+}
+
+func (e *ensurerCore) RateLimit(ctx context.Context) error {
+	return e.limiter.Wait(ctx)
+}
+
+// Close stops the rate limiter's refill goroutine. Callers must call this
+// once they're done with the ensurer - a new one is created per reconcile,
+// so leaving it uncalled leaks one goroutine and ticker per reconcile.
+func (e *ensurerCore) Close() {
+	e.limiter.Close()
+}
+
+// Lookup returns the reference another task committed under label, or nil
+// if it hasn't committed one (yet). Ensure implementations that need a
+// dependency's reference (e.g. the Tier-0 gateway path to create the
+// Tier-1 gateway under) must read it through here rather than state
+// directly: Ensure runs on the scheduler's worker goroutines, and an
+// unguarded read would race a sibling branch's Commit the same way the
+// scheduler's own pre-Ensure existence check would.
+func (e *ensurerCore) Lookup(state *api.NSXTInfraState, label string) *api.Reference {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	if state.References == nil {
+		return nil
+	}
+	return state.References[label]
+}
+
+// taskNode augments a task with the indices (into the ensurer's task slice)
+// of the tasks it depends on, so that independent branches of the pipeline
+// can be scheduled concurrently.
+type taskNode struct {
+	index int
+	tsk   task.Task
+	deps  []int
+}
+
+// buildTaskGraph resolves the dependency graph for tasks. Tasks that
+// implement task.DependencyAware declare their dependencies by label; tasks
+// that don't are assumed to depend on their immediate predecessor, which
+// preserves the original strictly-sequential behaviour for them. An
+// unknown label is a configuration error (e.g. a typo, or a task dropped
+// from enabledTasks that another task still depends on) and is rejected
+// rather than silently dropping the edge, which would otherwise let the
+// dependent task start before its dependency actually ran.
+func buildTaskGraph(tasks []task.Task) ([]*taskNode, error) {
+	labelIndex := make(map[string]int, len(tasks))
+	for i, tsk := range tasks {
+		labelIndex[tsk.Label()] = i
+	}
+
+	nodes := make([]*taskNode, len(tasks))
+	for i, tsk := range tasks {
+		node := &taskNode{index: i, tsk: tsk}
+		if dependent, ok := tsk.(task.DependencyAware); ok {
+			for _, label := range dependent.Dependencies() {
+				j, found := labelIndex[label]
+				if !found {
+					return nil, errors.Errorf("task %q depends on unknown task %q", tsk.Label(), label)
+				}
+				node.deps = append(node.deps, j)
+			}
+		} else if i > 0 {
+			node.deps = append(node.deps, i-1)
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// topologicalOrder returns the node indices of nodes in an order that
+// respects all dependency edges, using Kahn's algorithm. It returns an
+// error if the graph has a cycle: without this check, a cycle would make
+// EnsureInfrastructure's goroutines wait on each other's done channels
+// forever (since no node in the cycle can ever complete), and would make
+// EnsureInfrastructureDeleted silently drop the nodes in the cycle from
+// order instead of deleting them, leaking their NSX-T objects.
+func topologicalOrder(nodes []*taskNode) ([]int, error) {
+	inDegree := make([]int, len(nodes))
+	children := make([][]int, len(nodes))
+	for _, n := range nodes {
+		for _, d := range n.deps {
+			children[d] = append(children[d], n.index)
+			inDegree[n.index]++
+		}
+	}
+
+	queue := make([]int, 0, len(nodes))
+	for i, deg := range inDegree {
+		if deg == 0 {
+			queue = append(queue, i)
+		}
+	}
+
+	order := make([]int, 0, len(nodes))
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, i)
+		for _, c := range children[i] {
+			inDegree[c]--
+			if inDegree[c] == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	if len(order) != len(nodes) {
+		return nil, errors.Errorf("task dependency graph has a cycle involving %d task(s)", len(nodes)-len(order))
+	}
+	return order, nil
+}
+
+// tryRecover tries if the NSX-T reference has for some reason been lost and not be stored in the state.
+// It then tries to find the object by the garden and shoot tag to restore the reference.
+func (e *ensurerCore) tryRecover(ctx context.Context, spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState, tsk task.Task, lookup bool) error {
+	if !e.IsTryRecoverEnabled() {
+		return nil
+	}
+
+	e.stateMu.Lock()
+	lost := tsk.Reference(state) == nil
+	e.stateMu.Unlock()
+	if !lost {
+		return nil
+	}
+
+	var ref *api.Reference
+	var err error
+	switch rt := tsk.(type) {
+	case task.RecoverableTask:
+		ref, err = task.TryRecover(ctx, e, rt, e.recoverTags(spec, state))
+	case task.RecoverableAdvancedTask:
+		ref, err = rt.TryRecover(ctx, e, e.recoverTags(spec, state))
+	default:
+		if !lookup {
+			return nil
+		}
+		// not recoverable tasks are lookup tasks which may be needed for recover
+		if err := e.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		var action string
+		action, ref, err = tsk.Ensure(ctx, e, spec, state)
+		_ = action
+	}
+	if err != nil {
+		return err
+	}
+	if ref != nil {
+		e.stateMu.Lock()
+		tsk.Commit(state, ref)
+		e.stateMu.Unlock()
+	}
+	return nil
+}
+
+func (e *ensurerCore) EnsureInfrastructure(ctx context.Context, spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) error {
+	nodes, err := buildTaskGraph(e.tasks)
+	if err != nil {
+		return err
+	}
+	if _, err := topologicalOrder(nodes); err != nil {
+		return err
+	}
+	taskLog := e.taskLog.withShoot(spec.ClusterName)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make([]chan struct{}, len(nodes))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, maxConcurrentTasks)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	run := func(n *taskNode) {
+		defer wg.Done()
+		defer close(done[n.index])
+
+		for _, dep := range n.deps {
+			select {
+			case <-done[dep]:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		sem <- struct{}{}
+		defer func() { <-sem }()
+
+		_ = e.tryRecover(ctx, spec, state, n.tsk, false)
+
+		// Check under stateMu whether a sibling branch (or tryRecover above)
+		// already produced this task's reference, the same as tryRecover's
+		// own "lost" check - n.tsk.Ensure no longer reads state itself (see
+		// simpleTask.Ensure), precisely so this locked check is the only place
+		// the scheduler reads state.References while other goroutines may be
+		// concurrently committing into it.
+		e.stateMu.Lock()
+		existing := n.tsk.Reference(state)
+		e.stateMu.Unlock()
+		if existing != nil {
+			taskLog.logResult(n.tsk, "found", spec, existing, time.Now(), 0)
+			return
+		}
+
+		start := time.Now()
+		var action string
+		var ref *api.Reference
+		attempts, err := withRetry(ctx, e.retryPolicy, func(int) error {
+			if err := e.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			var ensureErr error
+			action, ref, ensureErr = n.tsk.Ensure(ctx, e, spec, state)
+			return ensureErr
+		})
+		if err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, n.tsk.Label()+" failed")
+			}
+			mu.Unlock()
+			cancel()
+			return
+		}
+
+		e.stateMu.Lock()
+		n.tsk.Commit(state, ref)
+		e.stateMu.Unlock()
+
+		taskLog.logResult(n.tsk, action, spec, ref, start, attempts)
+	}
+
+	wg.Add(len(nodes))
+	for _, n := range nodes {
+		go run(n)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func (e *ensurerCore) EnsureInfrastructureDeleted(ctx context.Context, spec *vinfra.NSXTInfraSpec, state *api.NSXTInfraState) error {
+	nodes, err := buildTaskGraph(e.tasks)
+	if err != nil {
+		return err
+	}
+	taskLog := e.taskLog
+	if spec != nil {
+		taskLog = taskLog.withShoot(spec.ClusterName)
+	}
+
+	// Delete in reverse topological order so a task is always deleted before
+	// the tasks it depends on, regardless of its position in e.tasks.
+	order, err := topologicalOrder(nodes)
+	if err != nil {
+		return err
+	}
+
+	if spec != nil {
+		// tryRecover needs the order of creation, i.e. topological order
+		for _, i := range order {
+			n := nodes[i]
+			err := e.tryRecover(ctx, *spec, state, n.tsk, true)
+			if err != nil {
+				keysAndVals := []interface{}{"error", err.Error()}
+				name := n.tsk.NameToLog(*spec)
+				if name != nil {
+					keysAndVals = append(keysAndVals, "name", *name)
+				}
+				taskLog.forTask(n.tsk.Label()).Info("try recover failed", keysAndVals...)
+			}
+		}
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		tsk := nodes[order[i]].tsk
+
+		start := time.Now()
+		var deleted bool
+		attempts, err := withRetry(ctx, e.retryPolicy, func(int) error {
+			if err := e.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			var deleteErr error
+			deleted, deleteErr = tsk.EnsureDeleted(ctx, e, state)
+			return deleteErr
+		})
+		if err != nil {
+			return errors.Wrapf(err, "deleting "+tsk.Label()+" failed")
+		}
+		if deleted {
+			tsk.Commit(state, nil)
+			taskLog.forTask(tsk.Label()).Info("deleted", "duration_ms", time.Since(start).Milliseconds(), "attempt", attempts)
+		}
+	}
+
+	// Orphan sweep: a partial failure earlier in reconciliation can lose a
+	// reference from state before its task gets a chance to delete the
+	// object it points to. List anything still bearing the shoot's tags and
+	// delete it so teardown is reliably terminal.
+	if spec != nil {
+		tags := e.recoverTags(*spec, state)
+		orphans, err := task.FindTaggedObjects(ctx, e, tags)
+		if err != nil {
+			return errors.Wrapf(err, "listing orphaned NSX-T objects failed")
+		}
+		for _, orphan := range orphans {
+			if err := task.DeleteTaggedObject(ctx, e, orphan); err != nil {
+				return errors.Wrapf(err, "deleting orphaned %s %s failed", orphan.Type, orphan.ID)
+			}
+			taskLog.delegate.Info("deleted orphaned object", "type", orphan.Type, "nsxt_id", orphan.ID)
+		}
+	}
+
+	// Remove the Principal Identity the ensurer created to authenticate to
+	// NSX-T. Only the Principal Identity is deleted; no trust certificate is
+	// deleted here.
+	if state.PrincipalIdentityName != "" {
+		if err := task.DeletePrincipalIdentity(ctx, e, state.PrincipalIdentityName); err != nil {
+			return errors.Wrapf(err, "removing NSX-T principal identity failed")
+		}
+		taskLog.delegate.Info("deleted principal identity", "name", state.PrincipalIdentityName)
+		state.PrincipalIdentityName = ""
+	}
+
+	return nil
+}
+
+// newEnsurerCore builds the scheduler shared by ensurer and vpcEnsurer.
+func newEnsurerCore(logger logr.Logger, nsxtConfig *vinfra.NSXTConfig, defaultNames []string, recoverTags func(vinfra.NSXTInfraSpec, *api.NSXTInfraState) []vinfra.Tag, opts []Option) (*ensurerCore, error) {
+	log.SetLogger(NewLogrBridge(logger.WithName("nsxt-sdk")))
+	connector, err := createConnector(nsxtConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating NSX-T connector failed")
+	}
+	nsxClient, err := createNSXClient(nsxtConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating NSX-T client failed")
+	}
+
+	core := &ensurerCore{
+		logger:      logger,
+		connector:   connector,
+		nsxtClient:  nsxClient,
+		taskLog:     newTaskLogger(logger),
+		retryPolicy: retryPolicyFromConfig(nsxtConfig),
+		limiter:     rateLimiterFromConfig(nsxtConfig),
+		recoverTags: recoverTags,
+	}
+
+	o := resolveOptions(opts)
+	names := o.enabledTasks
+	if names == nil {
+		names = defaultNames
+	}
+
+	tasks := make([]task.Task, 0, len(names)+len(o.extraTasks))
+	for _, name := range names {
+		factory, ok := task.Registry.Lookup(name)
+		if !ok {
+			return nil, errors.Errorf("no task registered under name %q", name)
+		}
+		tasks = append(tasks, factory(core))
+	}
+	tasks = append(tasks, o.extraTasks...)
+	core.tasks = tasks
+
+	return core, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ensurer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+	"github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure/task"
+)
+
+// fakeTask is a minimal task.Task used to exercise buildTaskGraph and
+// topologicalOrder without needing a real NSX-T connection.
+type fakeTask struct {
+	label string
+	deps  []string
+}
+
+func (t *fakeTask) Label() string                                    { return t.label }
+func (t *fakeTask) Dependencies() []string                           { return t.deps }
+func (t *fakeTask) NameToLog(vinfra.NSXTInfraSpec) *string            { return nil }
+func (t *fakeTask) Reference(*api.NSXTInfraState) *api.Reference     { return nil }
+func (t *fakeTask) Commit(*api.NSXTInfraState, *api.Reference)       {}
+func (t *fakeTask) Ensure(context.Context, task.EnsurerContext, vinfra.NSXTInfraSpec, *api.NSXTInfraState) (string, *api.Reference, error) {
+	return "created", &api.Reference{ID: t.label}, nil
+}
+func (t *fakeTask) EnsureDeleted(context.Context, task.EnsurerContext, *api.NSXTInfraState) (bool, error) {
+	return true, nil
+}
+
+var _ task.Task = &fakeTask{}
+var _ task.DependencyAware = &fakeTask{}
+
+func TestBuildTaskGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    []task.Task
+		wantDeps [][]int
+		wantErr  bool
+	}{
+		{
+			name: "explicit dependencies",
+			tasks: []task.Task{
+				&fakeTask{label: "a"},
+				&fakeTask{label: "b", deps: []string{"a"}},
+			},
+			wantDeps: [][]int{nil, {0}},
+		},
+		{
+			name: "no DependencyAware falls back to sequential",
+			tasks: []task.Task{
+				&noDepsTask{label: "a"},
+				&noDepsTask{label: "b"},
+			},
+			wantDeps: [][]int{nil, {0}},
+		},
+		{
+			name: "unknown dependency label is rejected",
+			tasks: []task.Task{
+				&fakeTask{label: "a", deps: []string{"does-not-exist"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := buildTaskGraph(tt.tasks)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, want := range tt.wantDeps {
+				if !reflect.DeepEqual(nodes[i].deps, want) {
+					t.Fatalf("node %q deps = %v, want %v", nodes[i].tsk.Label(), nodes[i].deps, want)
+				}
+			}
+		})
+	}
+}
+
+// noDepsTask is a task.Task that does NOT implement task.DependencyAware,
+// so buildTaskGraph falls back to its sequential-predecessor behaviour.
+type noDepsTask struct {
+	label string
+}
+
+func (t *noDepsTask) Label() string                                { return t.label }
+func (t *noDepsTask) NameToLog(vinfra.NSXTInfraSpec) *string        { return nil }
+func (t *noDepsTask) Reference(*api.NSXTInfraState) *api.Reference { return nil }
+func (t *noDepsTask) Commit(*api.NSXTInfraState, *api.Reference)   {}
+func (t *noDepsTask) Ensure(context.Context, task.EnsurerContext, vinfra.NSXTInfraSpec, *api.NSXTInfraState) (string, *api.Reference, error) {
+	return "created", &api.Reference{ID: t.label}, nil
+}
+func (t *noDepsTask) EnsureDeleted(context.Context, task.EnsurerContext, *api.NSXTInfraState) (bool, error) {
+	return true, nil
+}
+
+var _ task.Task = &noDepsTask{}
+
+func TestTopologicalOrder(t *testing.T) {
+	t.Run("respects dependency edges", func(t *testing.T) {
+		tasks := []task.Task{
+			&fakeTask{label: "a"},
+			&fakeTask{label: "b", deps: []string{"a"}},
+			&fakeTask{label: "c", deps: []string{"a"}},
+			&fakeTask{label: "d", deps: []string{"b", "c"}},
+		}
+		nodes, err := buildTaskGraph(tasks)
+		if err != nil {
+			t.Fatalf("buildTaskGraph: %v", err)
+		}
+		order, err := topologicalOrder(nodes)
+		if err != nil {
+			t.Fatalf("topologicalOrder: %v", err)
+		}
+		if len(order) != len(nodes) {
+			t.Fatalf("expected all %d nodes in order, got %d", len(nodes), len(order))
+		}
+		pos := make(map[string]int, len(order))
+		for i, idx := range order {
+			pos[nodes[idx].tsk.Label()] = i
+		}
+		if pos["a"] > pos["b"] || pos["a"] > pos["c"] || pos["b"] > pos["d"] || pos["c"] > pos["d"] {
+			t.Fatalf("order %v violates dependency edges", order)
+		}
+	})
+
+	t.Run("cycle is rejected instead of silently dropping nodes", func(t *testing.T) {
+		tasks := []task.Task{
+			&fakeTask{label: "a", deps: []string{"b"}},
+			&fakeTask{label: "b", deps: []string{"a"}},
+		}
+		nodes, err := buildTaskGraph(tasks)
+		if err != nil {
+			t.Fatalf("buildTaskGraph: %v", err)
+		}
+		if _, err := topologicalOrder(nodes); err == nil {
+			t.Fatalf("expected a cycle error, got none")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// IsNotFound reports whether err is the 404 Not Found NSX-T returns for an
+// object that doesn't exist. simpleTask.EnsureDeleted and the orphan-sweep
+// helpers in orphan.go use it to treat deleting an already-gone object as
+// success rather than an error.
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	se, ok := errors.Cause(err).(interface{ StatusCode() int })
+	return ok && se.StatusCode() == http.StatusNotFound
+}
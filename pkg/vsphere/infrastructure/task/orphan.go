@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/vsphere-automation-sdk-go/runtime/data"
+	"github.com/vmware/vsphere-automation-sdk-go/services/nsxt/infra"
+
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+// TaggedObject identifies a Policy-API object found by tag search,
+// independent of whether any task still references it in state. The
+// orphan sweep in EnsureInfrastructureDeleted deletes whatever this turns
+// up once every task has had a chance to delete its own object.
+type TaggedObject struct {
+	// Type is the object's Policy-API resource_type (e.g. "Tier1",
+	// "Segment", "StaticRoutes", "DhcpServerConfig"), as reported by the
+	// search API.
+	Type string
+	// ID is the object's Policy-API id, which its type-specific client
+	// deletes by.
+	ID string
+	// Path is the object's hierarchical path, kept for diagnostics (e.g. to
+	// name the object in an error if deleting it fails).
+	Path string
+}
+
+// searchQueryForTags builds an NSX-T Policy search query matching objects
+// that carry every tag in tags, so the orphan sweep doesn't pick up other
+// shoots' objects that happen to share just one of them.
+func searchQueryForTags(tags []vinfra.Tag) string {
+	query := ""
+	for _, t := range tags {
+		if query != "" {
+			query += " AND "
+		}
+		query += fmt.Sprintf("tags.scope:%s AND tags.tag:%s", t.Scope, t.Tag)
+	}
+	return query
+}
+
+// FindTaggedObjects searches NSX-T for every Policy-API object carrying
+// all of tags, paging through the search API's cursor until it is
+// exhausted.
+func FindTaggedObjects(ctx context.Context, ectx EnsurerContext, tags []vinfra.Tag) ([]TaggedObject, error) {
+	searchClient := infra.NewSearchClient(ectx.Connector())
+	query := searchQueryForTags(tags)
+
+	var found []TaggedObject
+	var cursor *string
+	for {
+		if err := ectx.RateLimit(ctx); err != nil {
+			return nil, err
+		}
+		result, err := searchClient.Query(query, cursor, nil, nil, nil, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "querying NSX-T for objects tagged %q failed", query)
+		}
+		for _, raw := range result.Results {
+			// The search API returns each hit as a generic StructValue - its
+			// shape depends on the hit's own resource_type, so unlike a
+			// typed client response, reading it goes through StringField
+			// rather than a field access on a concrete struct.
+			obj, ok := raw.(*data.StructValue)
+			if !ok {
+				continue
+			}
+			resourceType, err := obj.StringField("resource_type")
+			if err != nil {
+				continue
+			}
+			id, err := obj.StringField("id")
+			if err != nil {
+				continue
+			}
+			path, err := obj.StringField("path")
+			if err != nil {
+				continue
+			}
+			found = append(found, TaggedObject{Type: resourceType, ID: id, Path: path})
+		}
+		if result.Cursor == nil || *result.Cursor == "" {
+			break
+		}
+		cursor = result.Cursor
+	}
+	return found, nil
+}
+
+// DeleteTaggedObject deletes the object orphan points to, through the
+// Policy hierarchy client for its resource_type. It deletes Tier1 and
+// Segment objects only; an orphan of any other resource_type (including
+// the SNAT rules and IP allocations of the policy-tier1 pipeline and the
+// objects of the VPC pipeline) is not deleted and is returned as an error
+// rather than silently left behind. A 404 is treated as already-deleted,
+// the same as for a task's own EnsureDeleted.
+func DeleteTaggedObject(ctx context.Context, ectx EnsurerContext, orphan TaggedObject) error {
+	if err := ectx.RateLimit(ctx); err != nil {
+		return err
+	}
+	connector := ectx.Connector()
+
+	var err error
+	switch orphan.Type {
+	case "Tier1":
+		err = infra.NewTier1sClient(connector).Delete(orphan.ID, nil)
+	case "Segment":
+		err = infra.NewSegmentsClient(connector).Delete(orphan.ID)
+	default:
+		return errors.Errorf("no Policy hierarchy client registered for orphaned object type %q (id %s, path %s)", orphan.Type, orphan.ID, orphan.Path)
+	}
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "deleting orphaned %s %s failed", orphan.Type, orphan.ID)
+	}
+	return nil
+}
+
+// DeletePrincipalIdentity removes the Principal Identity the ensurer
+// created to authenticate as the shoot, by name. It does not delete a
+// trust certificate associated with it. A 404 is treated as
+// already-deleted.
+func DeletePrincipalIdentity(ctx context.Context, ectx EnsurerContext, name string) error {
+	if err := ectx.RateLimit(ctx); err != nil {
+		return err
+	}
+	identityClient := infra.NewPrincipalIdentitiesClient(ectx.Connector())
+	if err := identityClient.Delete(name, nil); err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "deleting principal identity %s failed", name)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import "fmt"
+
+// Factory builds a fresh Task instance for a single ensurer, given the
+// EnsurerContext it will run against. Tasks are built per-ensurer rather
+// than shared between ensurers.
+type Factory func(EnsurerContext) Task
+
+// registry resolves a task name (as listed in an ensurer's enabledTasks)
+// to the Factory that builds it. Built-in tasks register themselves in
+// their package's init(); out-of-tree tasks can call Registry.Register
+// from their own init() to make themselves selectable by name too.
+type registry struct {
+	factories map[string]Factory
+}
+
+// Registry is the process-wide task registry every ensurer resolves its
+// enabledTasks against.
+var Registry = &registry{factories: map[string]Factory{}}
+
+// Register adds factory under name, so it can later be resolved by
+// Registry.Lookup. It panics if name is already registered, the same way
+// database/sql and image's format registries do - a name collision is a
+// programming error, not a runtime condition to handle gracefully.
+func (r *registry) Register(name string, factory Factory) {
+	if _, exists := r.factories[name]; exists {
+		panic(fmt.Sprintf("task %q already registered", name))
+	}
+	r.factories[name] = factory
+}
+
+// Lookup resolves name to its Factory, if registered.
+func (r *registry) Lookup(name string) (Factory, bool) {
+	factory, ok := r.factories[name]
+	return factory, ok
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import "testing"
+
+func TestRegistryLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		lookup string
+		wantOk bool
+	}{
+		{name: "built-in task is registered", lookup: "tier1-gateway", wantOk: true},
+		{name: "unknown name is not found", lookup: "does-not-exist", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory, ok := Registry.Lookup(tt.lookup)
+			if ok != tt.wantOk {
+				t.Fatalf("Lookup(%q) ok = %v, want %v", tt.lookup, ok, tt.wantOk)
+			}
+			if ok && factory(nil) == nil {
+				t.Fatalf("Lookup(%q) factory returned a nil Task", tt.lookup)
+			}
+		})
+	}
+}
+
+func TestRegistryRegisterPanicsOnDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected Register to panic on a duplicate name")
+		}
+	}()
+	Registry.Register("tier1-gateway", func(EnsurerContext) Task { return nil })
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/vmware/go-vmware-nsxt"
+	vapiclient "github.com/vmware/vsphere-automation-sdk-go/runtime/protocol/client"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+// EnsurerContext is the subset of the ensurer a Task needs to talk to
+// NSX-T: its logger, its Policy-API connector, its Advanced-API client,
+// whether lost references should be recovered by tag search, and its
+// NSX-T call rate limit.
+type EnsurerContext interface {
+	Logger() logr.Logger
+	Connector() vapiclient.Connector
+	NSXTClient() *nsxt.APIClient
+	IsTryRecoverEnabled() bool
+	// RateLimit blocks until the ensurer's NSX-T call budget allows another
+	// call, or ctx is done. Callers making a Connector/NSXTClient call
+	// outside of Ensure/EnsureDeleted (which the scheduler already rate
+	// limits) must call this first.
+	RateLimit(ctx context.Context) error
+	// Lookup returns the reference another task committed under label, or
+	// nil if it hasn't committed one (yet). An Ensure implementation that
+	// needs a dependency's reference must read it through here, not via
+	// state directly - Ensure runs concurrently with sibling branches that
+	// may be committing into the same state.
+	Lookup(state *api.NSXTInfraState, label string) *api.Reference
+}
+
+// DependencyAware is implemented by tasks whose execution order depends on
+// other tasks rather than their position in the ensurer's task slice.
+// Dependencies returns the Label()s of the tasks that must be ensured
+// before this one runs; an unknown label is rejected by the ensurer rather
+// than silently ignored.
+type DependencyAware interface {
+	Dependencies() []string
+}
+
+// Task provisions (and tears down) a single NSX-T object on behalf of the
+// ensurer.
+type Task interface {
+	// Label identifies the task in the dependency graph, in logs, and as
+	// the key under which its reference is stored in state.
+	Label() string
+	// NameToLog returns a human-readable name for log lines, if the task
+	// has one at Ensure time.
+	NameToLog(spec vinfra.NSXTInfraSpec) *string
+	// Reference returns this task's current reference from state, or nil
+	// if it hasn't been created (or recovered) yet.
+	Reference(state *api.NSXTInfraState) *api.Reference
+	// Commit stores ref as this task's reference in state (nil clears it).
+	// The caller is responsible for synchronizing concurrent Commit calls
+	// against the same state - Task implementations must not call it from
+	// within Ensure.
+	Commit(state *api.NSXTInfraState, ref *api.Reference)
+	// Ensure creates (or finds) the NSX-T object for this task and returns
+	// the action taken ("created", "found", ...) and its reference. It
+	// must not mutate state itself: independent branches of the task graph
+	// may be ensuring siblings concurrently, so the caller commits the
+	// result under its own lock once Ensure returns.
+	Ensure(ctx context.Context, ectx EnsurerContext, spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) (action string, ref *api.Reference, err error)
+	// EnsureDeleted deletes the NSX-T object this task's reference points
+	// to, if any, and reports whether it actually deleted something. A 404
+	// returned by NSX-T is treated as already-deleted, not an error.
+	EnsureDeleted(ctx context.Context, ectx EnsurerContext, state *api.NSXTInfraState) (deleted bool, err error)
+}
+
+// RecoverableTask is implemented by Policy-API tasks that can recover a
+// reference lost from state by searching NSX-T for an object bearing the
+// shoot's tags, via the shared TryRecover helper.
+type RecoverableTask interface {
+	Task
+	// FindExisting searches for this task's NSX-T object by tag and
+	// returns its reference, or nil if none is found.
+	FindExisting(ctx context.Context, ectx EnsurerContext, tags []vinfra.Tag) (*api.Reference, error)
+}
+
+// TryRecover searches for rt's NSX-T object by tag and returns its
+// reference, if found. It does not commit the result - the caller does
+// that under its own synchronization, the same as for Task.Ensure.
+func TryRecover(ctx context.Context, ectx EnsurerContext, rt RecoverableTask, tags []vinfra.Tag) (*api.Reference, error) {
+	return rt.FindExisting(ctx, ectx, tags)
+}
+
+// RecoverableAdvancedTask is implemented by Advanced-API tasks, which look
+// up existing objects via the go-vmware-nsxt SDK rather than the Policy
+// connector and so recover via their own method instead of TryRecover.
+type RecoverableAdvancedTask interface {
+	Task
+	TryRecover(ctx context.Context, ectx EnsurerContext, tags []vinfra.Tag) (*api.Reference, error)
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package task
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+	vinfra "github.com/gardener/gardener-extension-provider-vsphere/pkg/vsphere/infrastructure"
+)
+
+// ensureFunc does the actual NSX-T work for a simpleTask's Ensure call.
+type ensureFunc func(ctx context.Context, ectx EnsurerContext, spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) (action string, ref *api.Reference, err error)
+
+// deleteFunc does the actual NSX-T work for a simpleTask's EnsureDeleted
+// call, given the task's current reference (never nil - EnsureDeleted
+// skips the call entirely when there is nothing to delete).
+type deleteFunc func(ctx context.Context, ectx EnsurerContext, ref *api.Reference) error
+
+// simpleTask is the common Task implementation for every built-in task: it
+// handles the parts that are the same for all of them (looking up and
+// storing its reference, skipping EnsureDeleted when already gone,
+// classifying a 404 on delete as success) and defers the NSX-T specific
+// work to ensureFn/deleteFn. A task factory that leaves either nil gets a
+// descriptive error at Ensure/EnsureDeleted time instead of a nil-func-call
+// panic.
+type simpleTask struct {
+	label       string
+	deps        []string
+	nameToLogFn func(spec vinfra.NSXTInfraSpec) *string
+	ensureFn    ensureFunc
+	deleteFn    deleteFunc
+}
+
+func (t *simpleTask) Label() string {
+	return t.label
+}
+
+func (t *simpleTask) Dependencies() []string {
+	return t.deps
+}
+
+func (t *simpleTask) NameToLog(spec vinfra.NSXTInfraSpec) *string {
+	if t.nameToLogFn == nil {
+		return nil
+	}
+	return t.nameToLogFn(spec)
+}
+
+func (t *simpleTask) Reference(state *api.NSXTInfraState) *api.Reference {
+	if state.References == nil {
+		return nil
+	}
+	return state.References[t.label]
+}
+
+func (t *simpleTask) Commit(state *api.NSXTInfraState, ref *api.Reference) {
+	if ref == nil {
+		if state.References != nil {
+			delete(state.References, t.label)
+		}
+		return
+	}
+	if state.References == nil {
+		state.References = map[string]*api.Reference{}
+	}
+	state.References[t.label] = ref
+}
+
+// Ensure assumes the caller has already checked (under its own lock) that
+// this task has no reference yet - unlike the rest of simpleTask, it must
+// not read state.References itself: the scheduler runs independent
+// branches of the task graph on separate goroutines, so an unguarded read
+// here would race a sibling branch's Commit into the same map.
+func (t *simpleTask) Ensure(ctx context.Context, ectx EnsurerContext, spec vinfra.NSXTInfraSpec, state *api.NSXTInfraState) (string, *api.Reference, error) {
+	if t.ensureFn == nil {
+		return "", nil, errors.Errorf("%s: no ensureFn wired up for this task", t.label)
+	}
+	return t.ensureFn(ctx, ectx, spec, state)
+}
+
+func (t *simpleTask) EnsureDeleted(ctx context.Context, ectx EnsurerContext, state *api.NSXTInfraState) (bool, error) {
+	ref := t.Reference(state)
+	if ref == nil {
+		return false, nil
+	}
+	if t.deleteFn == nil {
+		return false, errors.Errorf("%s: no deleteFn wired up for this task", t.label)
+	}
+	if err := t.deleteFn(ctx, ectx, ref); err != nil {
+		if IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Tier1GatewayTask creates the shoot's Tier-1 gateway below the shared
+// Tier-0 gateway found by the "lookup-tier0-gateway" task.
+func Tier1GatewayTask() Task {
+	return &simpleTask{
+		label: "tier1-gateway",
+		deps:  []string{"lookup-tier0-gateway"},
+	}
+}
+
+// Tier1GatewayLocaleServiceTask attaches the Tier-1 gateway to an edge
+// cluster so it can host stateful services (NAT, DHCP relay, ...).
+func Tier1GatewayLocaleServiceTask() Task {
+	return &simpleTask{
+		label: "tier1-gateway-locale-service",
+		deps:  []string{"tier1-gateway", "lookup-edge-cluster"},
+	}
+}
+
+// SegmentTask creates the shoot's Segment attached to the Tier-1 gateway.
+func SegmentTask() Task {
+	return &simpleTask{
+		label: "segment",
+		deps:  []string{"tier1-gateway-locale-service", "lookup-transport-zone"},
+	}
+}
+
+// SNATIPAddressAllocationTask allocates a SNAT IP from the shared SNAT IP
+// pool found by the "lookup-snat-ip-pool" task.
+func SNATIPAddressAllocationTask() Task {
+	return &simpleTask{
+		label: "snat-ip-address-allocation",
+		deps:  []string{"lookup-snat-ip-pool"},
+	}
+}
+
+// SNATIPAddressRealizationTask waits for the allocated SNAT IP to be
+// realized before a rule can reference it.
+func SNATIPAddressRealizationTask() Task {
+	return &simpleTask{
+		label: "snat-ip-address-realization",
+		deps:  []string{"snat-ip-address-allocation"},
+	}
+}
+
+// SNATRuleTask creates the Tier-1 gateway's SNAT rule translating the
+// shoot's Segment subnet to the allocated SNAT IP. It depends on the
+// Tier-1 gateway, the realized SNAT IP allocation, and the SNAT IP pool
+// lookup - not on the Segment or the Advanced-API DHCP subtree, so that
+// subtree can run concurrently with this one.
+func SNATRuleTask() Task {
+	return &simpleTask{
+		label: "snat-rule",
+		deps:  []string{"tier1-gateway", "snat-ip-address-realization", "lookup-snat-ip-pool"},
+	}
+}
+
+// AdvancedLookupLogicalSwitchTask looks up the Advanced-API logical switch
+// backing the Segment created by SegmentTask, which the Advanced-API DHCP
+// tasks attach to.
+func AdvancedLookupLogicalSwitchTask() Task {
+	return &simpleTask{
+		label: "advanced-lookup-logical-switch",
+		deps:  []string{"segment"},
+	}
+}
+
+// AdvancedDHCPProfileTask creates the Advanced-API DHCP profile shared by
+// the shoot's DHCP server.
+func AdvancedDHCPProfileTask() Task {
+	return &simpleTask{
+		label: "advanced-dhcp-profile",
+	}
+}
+
+// AdvancedDHCPServerTask creates the Advanced-API DHCP server attached to
+// the Segment's logical switch.
+func AdvancedDHCPServerTask() Task {
+	return &simpleTask{
+		label: "advanced-dhcp-server",
+		deps:  []string{"advanced-dhcp-profile", "advanced-lookup-logical-switch"},
+	}
+}
+
+// AdvancedDHCPPortTask creates the logical port connecting the DHCP server
+// to the Segment's logical switch.
+func AdvancedDHCPPortTask() Task {
+	return &simpleTask{
+		label: "advanced-dhcp-port",
+		deps:  []string{"advanced-dhcp-server"},
+	}
+}
+
+// AdvancedDHCPIPPoolTask configures the DHCP server's IP pool.
+func AdvancedDHCPIPPoolTask() Task {
+	return &simpleTask{
+		label: "advanced-dhcp-ip-pool",
+		deps:  []string{"advanced-dhcp-server"},
+	}
+}
+
+// LookupTier0GatewayTask looks up the shared Tier-0 gateway shoots attach
+// their Tier-1 gateway to. It has no dependencies, so it can run
+// concurrently with the other lookup tasks.
+func LookupTier0GatewayTask() Task {
+	return &simpleTask{label: "lookup-tier0-gateway"}
+}
+
+// LookupTransportZoneTask looks up the overlay transport zone the Segment
+// is created on.
+func LookupTransportZoneTask() Task {
+	return &simpleTask{label: "lookup-transport-zone"}
+}
+
+// LookupEdgeClusterTask looks up the edge cluster the Tier-1 gateway's
+// locale service is hosted on.
+func LookupEdgeClusterTask() Task {
+	return &simpleTask{label: "lookup-edge-cluster"}
+}
+
+// LookupSNATIPPoolTask looks up the shared IP pool SNAT addresses are
+// allocated from.
+func LookupSNATIPPoolTask() Task {
+	return &simpleTask{label: "lookup-snat-ip-pool"}
+}
+
+// LookupProjectTask looks up the NSX-T Project the shoot's VPC is created
+// under. It has no dependencies, so it runs first in the VPC pipeline.
+func LookupProjectTask() Task {
+	return &simpleTask{label: "lookup-project"}
+}
+
+// VPCTask creates the shoot's VPC under the Project found by
+// "lookup-project".
+func VPCTask() Task {
+	return &simpleTask{
+		label: "vpc",
+		deps:  []string{"lookup-project"},
+	}
+}
+
+// VPCSubnetTask creates the shoot's Subnet within its VPC.
+func VPCSubnetTask() Task {
+	return &simpleTask{
+		label: "vpc-subnet",
+		deps:  []string{"vpc"},
+	}
+}
+
+// VPCSNATTask configures the VPC's SNAT IP for the Subnet created by
+// "vpc-subnet".
+func VPCSNATTask() Task {
+	return &simpleTask{
+		label: "vpc-snat",
+		deps:  []string{"vpc-subnet"},
+	}
+}
+
+// init registers every built-in task under the name used in
+// ensurer.defaultTaskNames or ensurer.defaultVPCTaskNames, so
+// NewNSXTInfrastructureEnsurer and NewNSXTVPCInfrastructureEnsurer can
+// resolve them by name instead of constructing them directly.
+func init() {
+	register := func(name string, build func() Task) {
+		Registry.Register(name, func(EnsurerContext) Task { return build() })
+	}
+
+	register("tier1-gateway", Tier1GatewayTask)
+	register("tier1-gateway-locale-service", Tier1GatewayLocaleServiceTask)
+	register("segment", SegmentTask)
+	register("snat-ip-address-allocation", SNATIPAddressAllocationTask)
+	register("snat-ip-address-realization", SNATIPAddressRealizationTask)
+	register("snat-rule", SNATRuleTask)
+	register("advanced-lookup-logical-switch", AdvancedLookupLogicalSwitchTask)
+	register("advanced-dhcp-profile", AdvancedDHCPProfileTask)
+	register("advanced-dhcp-server", AdvancedDHCPServerTask)
+	register("advanced-dhcp-port", AdvancedDHCPPortTask)
+	register("advanced-dhcp-ip-pool", AdvancedDHCPIPPoolTask)
+	register("lookup-tier0-gateway", LookupTier0GatewayTask)
+	register("lookup-transport-zone", LookupTransportZoneTask)
+	register("lookup-edge-cluster", LookupEdgeClusterTask)
+	register("lookup-snat-ip-pool", LookupSNATIPPoolTask)
+	register("lookup-project", LookupProjectTask)
+	register("vpc", VPCTask)
+	register("vpc-subnet", VPCSubnetTask)
+	register("vpc-snat", VPCSNATTask)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	api "github.com/gardener/gardener-extension-provider-vsphere/pkg/apis/vsphere"
+)
+
+// NSXTMode selects which infrastructure pipeline an ensurer runs.
+type NSXTMode string
+
+const (
+	// NSXTModePolicyTier1 provisions a shoot as a Tier-1 gateway and
+	// Segment under /infra. This is the default when Mode is empty.
+	NSXTModePolicyTier1 NSXTMode = "policy-tier1"
+	// NSXTModeVPC provisions a shoot as a VPC under an NSX-T Project,
+	// NSX-T's multi-tenant model.
+	NSXTModeVPC NSXTMode = "vpc"
+)
+
+// NSXTConfig holds the settings needed to connect to NSX-T and to drive
+// infrastructure reconciliation.
+type NSXTConfig struct {
+	Host               string
+	User               string
+	Password           string
+	InsecureSkipVerify bool
+
+	// Mode selects the infrastructure pipeline; NSXTModePolicyTier1 is used
+	// when empty.
+	Mode NSXTMode
+
+	// RetryInitialInterval is the delay before the first retry of a failed
+	// task call; ensurer.defaultRetryPolicy is used when zero.
+	RetryInitialInterval time.Duration
+	// RetryMaxElapsed bounds the total time spent retrying a single task
+	// call; ensurer.defaultRetryPolicy is used when zero.
+	RetryMaxElapsed time.Duration
+
+	// RateLimitQPS bounds the rate of calls an ensurer issues through its
+	// NSX-T connector; ensurer.defaultRateLimitQPS is used when zero.
+	RateLimitQPS float64
+	// RateLimitBurst bounds how many calls an ensurer can issue back to
+	// back before RateLimitQPS throttles it; ensurer.defaultRateLimitBurst
+	// is used when zero.
+	RateLimitBurst int
+}
+
+// Tag is an NSX-T scope/tag pair used to mark the objects belonging to a
+// shoot so they can be found again later (to recover a lost reference, or
+// to sweep orphans left behind by a partial failure).
+type Tag struct {
+	Scope string
+	Tag   string
+}
+
+// NSXTInfraSpec describes the shoot infrastructure to reconcile.
+type NSXTInfraSpec struct {
+	// ClusterName is the shoot's technical cluster id.
+	ClusterName string
+}
+
+// CreateTags returns the tags used to mark the Policy-API objects created
+// for this shoot.
+func (s NSXTInfraSpec) CreateTags() []Tag {
+	return []Tag{{Scope: "gardener-cluster", Tag: s.ClusterName}}
+}
+
+// CreateCommonTags returns the tags used to mark the Advanced-API objects
+// created for this shoot.
+func (s NSXTInfraSpec) CreateCommonTags() []Tag {
+	return s.CreateTags()
+}
+
+// CreateProjectScopedTags returns the tags used to mark, recover and sweep
+// this shoot's objects in the VPC infrastructure mode, additionally scoped
+// to its NSX-T project so the tag search doesn't have to cross projects.
+func (s NSXTInfraSpec) CreateProjectScopedTags(vpc *api.VPCState) []Tag {
+	tags := s.CreateTags()
+	if vpc != nil {
+		tags = append(tags, Tag{Scope: "gardener-project", Tag: vpc.ProjectID})
+	}
+	return tags
+}
+
+// NSXTInfrastructureEnsurer reconciles (and tears down) the NSX-T
+// infrastructure for a single shoot.
+type NSXTInfrastructureEnsurer interface {
+	EnsureInfrastructure(ctx context.Context, spec NSXTInfraSpec, state *api.NSXTInfraState) error
+	EnsureInfrastructureDeleted(ctx context.Context, spec *NSXTInfraSpec, state *api.NSXTInfraState) error
+	// Close releases the ensurer's background resources (its rate limiter's
+	// refill goroutine). A new ensurer is created per reconcile via
+	// NewNSXTInfrastructureEnsurer, so the caller must call Close once the
+	// reconcile is done with it.
+	Close()
+}